@@ -4,23 +4,26 @@ import (
 	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
-// possible api:
-// signature := NewSignature(accessKey, secret, endpoint, service)
-// signature.Sign(r *http.Request)
-
 const (
 	iSO8601BasicFormat      = "20060102T150405Z"
 	iSO8601BasicFormatShort = "20060102"
+
+	// unsignedPayload is the sentinel Glacier/S3 accept in place of a real
+	// payload hash, letting a caller sign a request without buffering (or
+	// even knowing) the body up front.
+	unsignedPayload = "UNSIGNED-PAYLOAD"
 )
 
 var (
@@ -70,40 +73,157 @@ type Keys struct {
 	Access, Secret string
 }
 
-// TODO prefilled ones
-type Region struct {
-	Region string // human readable name
-	Name   string // canonical name
-	// TODO CloudFormation Endpoint, CloundFront Endpoint etc.
-	Glacier string
+// Signer signs requests (and presigns URLs) for Endpoint, pulling fresh keys
+// from Credentials on every call, per AWS Signature Version 4:
+// http://docs.amazonwebservices.com/general/latest/gr/signature-version-4.html
+//
+// Endpoint carries the SigningRegion/SigningName that belong in the
+// credential scope, which for some services (see Resolver) differ from the
+// region or service name used to pick the host.
+type Signer struct {
+	Credentials Credentials
+	Endpoint    ResolvedEndpoint
 }
 
-var (
-	USEast = &Region{
-		"US East (Northern Virginia)",
-		"us-east-1",
-		"glacier.us-east-1.amazonaws.com"}
-)
+// NewSigner returns a Signer that signs requests to endpoint using
+// credentials.
+func NewSigner(credentials Credentials, endpoint ResolvedEndpoint) *Signer {
+	return &Signer{Credentials: credentials, Endpoint: endpoint}
+}
 
-type Signature [sha256.Size]byte
+// credentialScope returns the non-secret portion of the credential, e.g.
+// "20060102/us-east-1/glacier/aws4_request".
+func (s *Signer) credentialScope(t time.Time) string {
+	return fmt.Sprintf("%s/%s/%s/aws4_request", t.Format(iSO8601BasicFormatShort), s.Endpoint.SigningRegion, s.Endpoint.SigningName)
+}
 
-func NewSignature(k Keys, t time.Time, r *Region, service string) *Signature {
-	// var hh [sha256.Size]byte
-	h := hmac.New(sha256.New, []byte("AWS4"+k.Secret))
-	h.Write([]byte(t.Format(iSO8601BasicFormatShort)))
-	h = hmac.New(sha256.New, h.Sum(nil))
-	h.Write([]byte(r.Name))
-	// h.Sum(hh[:0])
-	h = hmac.New(sha256.New, h.Sum(nil))
-	h.Write([]byte(service))
-	h = hmac.New(sha256.New, h.Sum(nil))
-	h.Write([]byte("aws4_request"))
-	// h.Sum(hh[:0])
+// Sign adds an Authorization header to r, along with the X-Amz-Date and
+// X-Amz-Content-Sha256 headers it depends on. Unless X-Amz-Content-Sha256
+// is already set, r.Body, if any, is fully consumed but replaced with an
+// equivalent replayable reader so the caller can still send r afterwards.
+func (s *Signer) Sign(r *http.Request) error {
+	accessKey, secretKey, sessionToken, err := s.Credentials.Retrieve()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if r.Host == "" {
+		r.Host = r.URL.Host
+	}
+	r.Header.Set("X-Amz-Date", now.Format(iSO8601BasicFormat))
+	if sessionToken != "" {
+		r.Header.Set("x-amz-security-token", sessionToken)
+	}
+
+	cr, headers, err := CreateCanonicalRequest(r)
+	if err != nil {
+		return err
+	}
+	sts, err := CreateStringToSign(cr, now.Format(time.RFC1123), s.credentialScope(now))
+	if err != nil {
+		return err
+	}
+	sig, err := CreateSignature(now.Format(iSO8601BasicFormatShort), s.Endpoint.SigningRegion, s.Endpoint.SigningName, secretKey, sts)
+	if err != nil {
+		return err
+	}
+
+	r.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, s.credentialScope(now), strings.Join(headers, ";"), sig))
 	return nil
 }
 
+// Presign returns a copy of r's URL with the Sigv4 query-string signing
+// parameters (X-Amz-Algorithm, X-Amz-Credential, X-Amz-Date, X-Amz-Expires,
+// X-Amz-SignedHeaders, X-Amz-Signature) added, granting access to r for the
+// next expires without requiring an Authorization header. r itself is left
+// unmodified. Only the host is signed: a presigned URL carries no other
+// headers, and the payload is always treated as unsigned, as Glacier and S3
+// both require for this variant.
+func (s *Signer) Presign(r *http.Request, expires time.Duration) (*url.URL, error) {
+	accessKey, secretKey, sessionToken, err := s.Credentials.Retrieve()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+
+	u := *r.URL
+	q := u.Query()
+	q.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	q.Set("X-Amz-Credential", fmt.Sprintf("%s/%s", accessKey, s.credentialScope(now)))
+	q.Set("X-Amz-Date", now.Format(iSO8601BasicFormat))
+	q.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	// signReq below carries no headers of its own, so "host" is the only
+	// entry createCanonicalRequest will ever add to the signed-headers list
+	// for it; declare that here, before the query string (which the
+	// canonical request's signature covers) is finalized below.
+	q.Set("X-Amz-SignedHeaders", "host")
+	if sessionToken != "" {
+		q.Set("X-Amz-Security-Token", sessionToken)
+	}
+	u.RawQuery = q.Encode()
+
+	// signReq carries no headers of its own: only "host" is ever signed for
+	// a presigned URL, so the canonical request must be built without
+	// X-Amz-Content-Sha256 (or any other header) folded into the
+	// canonicalized/signed headers list that doesn't actually get sent.
+	signReq := &http.Request{
+		Method: r.Method,
+		URL:    &u,
+		Host:   host,
+	}
+	cr, headers, err := createCanonicalRequest(signReq, unsignedPayload)
+	if err != nil {
+		return nil, err
+	}
+	if joined := strings.Join(headers, ";"); joined != "host" {
+		return nil, fmt.Errorf("aws: presign signed unexpected headers %q", joined)
+	}
+	sts, err := CreateStringToSign(cr, now.Format(time.RFC1123), s.credentialScope(now))
+	if err != nil {
+		return nil, err
+	}
+	sig, err := CreateSignature(now.Format(iSO8601BasicFormatShort), s.Endpoint.SigningRegion, s.Endpoint.SigningName, secretKey, sts)
+	if err != nil {
+		return nil, err
+	}
+
+	q.Set("X-Amz-Signature", string(sig))
+	u.RawQuery = q.Encode()
+	return &u, nil
+}
+
 // http://docs.amazonwebservices.com/general/latest/gr/sigv4-create-canonical-request.html
+//
+// As a side effect, CreateCanonicalRequest consumes r.Body (replacing it
+// with an equivalent replayable reader) and sets X-Amz-Content-Sha256 to
+// the payload hash it used, unless the header was already present -
+// callers can pre-set it to "UNSIGNED-PAYLOAD" to skip hashing the body.
 func CreateCanonicalRequest(r *http.Request) ([]byte, []string, error) {
+	payloadHash, err := hashPayload(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	cr, headers, err := createCanonicalRequest(r, payloadHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	r.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	return cr, headers, nil
+}
+
+// createCanonicalRequest builds the canonical request for r using
+// payloadHash as its final line, without reading or touching
+// X-Amz-Content-Sha256 on r.Header. Presign uses this directly so that an
+// unsigned-payload marker never leaks into the canonicalized (and thus
+// signed) headers of a request that doesn't actually carry it.
+func createCanonicalRequest(r *http.Request, payloadHash string) ([]byte, []string, error) {
 	var crb bytes.Buffer // canonical request buffer
 
 	// 1
@@ -119,22 +239,30 @@ func CreateCanonicalRequest(r *http.Request) ([]byte, []string, error) {
 	// 2
 	// go's path.Clean will remove the trailing slash, if one exists, check if
 	// it will need to be readded
-	var ts bool
-	if r.URL.Path[len(r.URL.Path)-1] == '/' {
-		for i := len(r.URL.Path) - 2; i > 0; i-- {
-			if r.URL.Path[i] != '/' && r.URL.Path[i] != '.' {
-				ts = true
-				break
-			}
-		}
+	p := r.URL.Path
+	if p == "" {
+		p = "/"
 	}
 	var cp string // canonical path
-	parts := strings.Split(path.Clean(r.URL.Path)[1:], "/")
-	for i := range parts {
-		cp += "/" + encode(parts[i])
-	}
-	if ts {
-		cp += "/"
+	if p == "/" {
+		cp = "/"
+	} else {
+		var ts bool
+		if p[len(p)-1] == '/' {
+			for i := len(p) - 2; i > 0; i-- {
+				if p[i] != '/' && p[i] != '.' {
+					ts = true
+					break
+				}
+			}
+		}
+		parts := strings.Split(path.Clean(p)[1:], "/")
+		for i := range parts {
+			cp += "/" + encode(parts[i])
+		}
+		if ts {
+			cp += "/"
+		}
 	}
 	_, err = crb.WriteString(cp)
 	if err != nil {
@@ -209,7 +337,10 @@ func CreateCanonicalRequest(r *http.Request) ([]byte, []string, error) {
 			sort.Strings(values)
 			value = strings.Join(values, ",")
 		}
-		_, err := crb.WriteString(value)
+		_, err = crb.WriteString(value)
+		if err != nil {
+			return nil, nil, err
+		}
 		err = crb.WriteByte('\n')
 		if err != nil {
 			return nil, nil, err
@@ -231,13 +362,7 @@ func CreateCanonicalRequest(r *http.Request) ([]byte, []string, error) {
 	}
 
 	// 6
-	hash := sha256.New()
-	_, err = io.Copy(hash, r.Body)
-	if err != nil {
-		return nil, nil, err
-	}
-	var hashed [sha256.Size]byte
-	_, err = fmt.Fprintf(&crb, "%x", hash.Sum(hashed[:0]))
+	_, err = crb.WriteString(payloadHash)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -245,6 +370,31 @@ func CreateCanonicalRequest(r *http.Request) ([]byte, []string, error) {
 	return crb.Bytes(), headers, nil
 }
 
+// hashPayload returns the hex-encoded sha256 of r.Body, hashing it while
+// streaming it into a buffer and then rewinding r.Body to that buffer so the
+// request can still be sent afterwards. If X-Amz-Content-Sha256 is already
+// set (e.g. to "UNSIGNED-PAYLOAD"), that value is used as-is and r.Body is
+// left untouched.
+func hashPayload(r *http.Request) (string, error) {
+	if h := r.Header.Get("X-Amz-Content-Sha256"); h != "" {
+		return h, nil
+	}
+	if r.Body == nil {
+		return hex.EncodeToString(sha256.New().Sum(nil)), nil
+	}
+
+	hash := sha256.New()
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, io.TeeReader(r.Body, hash)); err != nil {
+		return "", err
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(buf.Bytes()))
+	r.ContentLength = int64(buf.Len())
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 func CreateStringToSign(cr []byte, date, cs string) ([]byte, error) {
 	var sts bytes.Buffer
 
@@ -285,33 +435,24 @@ func CreateStringToSign(cr []byte, date, cs string) ([]byte, error) {
 	return sts.Bytes(), nil
 }
 
-func CreateSignature(date, region, service string, sts []byte) ([]byte, error) {
-	// 1
-	h := hmac.New(sha256.New, []byte("AWS4"+v4SecretKey))
-	_, err := h.Write([]byte(date))
-	if err != nil {
-		return nil, err
-	}
-	var hh [sha256.Size]byte
+// CreateSignature derives the Sigv4 signing key from secretKey, date, region
+// and service, then uses it to HMAC-SHA256 sts, returning the hex-encoded
+// result.
+func CreateSignature(date, region, service, secretKey string, sts []byte) ([]byte, error) {
+	h := hmac.New(sha256.New, []byte("AWS4"+secretKey))
+	h.Write([]byte(date))
+
 	h = hmac.New(sha256.New, h.Sum(nil))
-	_, err = h.Write([]byte(region))
-	h.Sum(hh[:0])
+	h.Write([]byte(region))
+
 	h = hmac.New(sha256.New, h.Sum(nil))
-	_, err = h.Write([]byte(service))
-	if err != nil {
-		return nil, err
-	}
+	h.Write([]byte(service))
+
 	h = hmac.New(sha256.New, h.Sum(nil))
-	_, err = h.Write([]byte("aws4_request"))
-	h.Sum(hh[:0])
+	h.Write([]byte("aws4_request"))
 
-	// 2
 	h = hmac.New(sha256.New, h.Sum(nil))
-	_, err = h.Write(sts)
-	if err != nil {
-		return nil, err
-	}
-	h.Sum(hh[:0])
+	h.Write(sts)
 
 	return []byte(fmt.Sprintf("%x", h.Sum(nil))), nil
 }
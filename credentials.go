@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials supplies the access key, secret key and (for temporary
+// credentials) session token used to sign a request, refreshing them itself
+// when they expire.
+type Credentials interface {
+	// Retrieve returns the current access key, secret key and session
+	// token (empty for credentials that don't use one), fetching or
+	// refreshing them first if necessary.
+	Retrieve() (accessKey, secretKey, sessionToken string, err error)
+	// IsExpired reports whether the credentials last returned by Retrieve
+	// (if any) are no longer valid, so a caller caching them, such as
+	// ChainProvider, must call Retrieve again.
+	IsExpired() bool
+}
+
+// StaticProvider is a Credentials that always returns the same Keys; it
+// never expires.
+type StaticProvider struct {
+	Keys Keys
+}
+
+// NewStaticProvider wraps keys as a Credentials.
+func NewStaticProvider(keys Keys) *StaticProvider {
+	return &StaticProvider{Keys: keys}
+}
+
+func (p *StaticProvider) Retrieve() (accessKey, secretKey, sessionToken string, err error) {
+	return p.Keys.Access, p.Keys.Secret, "", nil
+}
+
+func (p *StaticProvider) IsExpired() bool {
+	return false
+}
+
+// ChainProvider tries each of Providers in turn, caching whichever one
+// first succeeds until that provider's credentials expire. A ChainProvider
+// is commonly shared across many goroutines signing requests concurrently,
+// so mu guards the cached fields below.
+type ChainProvider struct {
+	Providers []Credentials
+
+	mu                              sync.Mutex
+	current                         Credentials
+	accessKey, secretKey, sessToken string
+}
+
+// NewChainProvider returns a ChainProvider trying providers in order.
+func NewChainProvider(providers ...Credentials) *ChainProvider {
+	return &ChainProvider{Providers: providers}
+}
+
+func (c *ChainProvider) Retrieve() (accessKey, secretKey, sessionToken string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.current != nil && !c.current.IsExpired() {
+		return c.accessKey, c.secretKey, c.sessToken, nil
+	}
+	for _, p := range c.Providers {
+		accessKey, secretKey, sessionToken, err = p.Retrieve()
+		if err != nil {
+			continue
+		}
+		c.current = p
+		c.accessKey, c.secretKey, c.sessToken = accessKey, secretKey, sessionToken
+		return accessKey, secretKey, sessionToken, nil
+	}
+	if err == nil {
+		err = errors.New("aws: no credential provider in the chain returned valid credentials")
+	}
+	return "", "", "", err
+}
+
+func (c *ChainProvider) IsExpired() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.current == nil || c.current.IsExpired()
+}
+
+// ec2MetadataCredentialsURL is the instance metadata path that lists (as a
+// GET against the bare path) the name of the role attached to the instance,
+// and (as a GET against <path>/<role>) that role's current credentials.
+const ec2MetadataCredentialsURL = "http://169.254.169.254/latest/meta-data/iam/security-credentials/"
+
+// EC2RoleProvider retrieves temporary credentials from the EC2 instance
+// metadata service, for code running on an instance with an attached IAM
+// role. mu guards expiration, since a Signer typically shares one
+// EC2RoleProvider across every goroutine signing requests.
+type EC2RoleProvider struct {
+	Client *http.Client
+
+	mu         sync.Mutex
+	expiration time.Time
+}
+
+// NewEC2RoleProvider returns an EC2RoleProvider using http.DefaultClient.
+func NewEC2RoleProvider() *EC2RoleProvider {
+	return &EC2RoleProvider{Client: http.DefaultClient}
+}
+
+type ec2RoleCredentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	Token           string
+	Expiration      time.Time
+}
+
+func (p *EC2RoleProvider) Retrieve() (accessKey, secretKey, sessionToken string, err error) {
+	role, err := p.role()
+	if err != nil {
+		return "", "", "", err
+	}
+
+	resp, err := p.Client.Get(ec2MetadataCredentialsURL + role)
+	if err != nil {
+		return "", "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", "", fmt.Errorf("aws: ec2 metadata credentials request returned %s", resp.Status)
+	}
+
+	var creds ec2RoleCredentials
+	if err := json.NewDecoder(resp.Body).Decode(&creds); err != nil {
+		return "", "", "", err
+	}
+	p.mu.Lock()
+	p.expiration = creds.Expiration
+	p.mu.Unlock()
+	return creds.AccessKeyId, creds.SecretAccessKey, creds.Token, nil
+}
+
+// role discovers the name of the IAM role attached to the instance.
+func (p *EC2RoleProvider) role() (string, error) {
+	resp, err := p.Client.Get(ec2MetadataCredentialsURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("aws: ec2 metadata role request returned %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	role := strings.TrimSpace(strings.SplitN(string(body), "\n", 2)[0])
+	if role == "" {
+		return "", errors.New("aws: instance has no IAM role attached")
+	}
+	return role, nil
+}
+
+func (p *EC2RoleProvider) IsExpired() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.expiration.IsZero() || time.Now().After(p.expiration)
+}
+
+// AssumeRoleProvider retrieves temporary credentials for roleArn by calling
+// STS AssumeRole, signing the request with an inner set of credentials
+// (e.g. a StaticProvider for a user, or an EC2RoleProvider for the
+// instance's own role). mu guards expiration, since a Signer typically
+// shares one AssumeRoleProvider across every goroutine signing requests.
+type AssumeRoleProvider struct {
+	RoleArn         string
+	RoleSessionName string
+	Credentials     Credentials
+	Client          *http.Client
+
+	mu         sync.Mutex
+	expiration time.Time
+}
+
+// NewAssumeRoleProvider returns an AssumeRoleProvider that assumes roleArn
+// under sessionName, signing the AssumeRole call with creds.
+func NewAssumeRoleProvider(roleArn, sessionName string, creds Credentials) *AssumeRoleProvider {
+	return &AssumeRoleProvider{
+		RoleArn:         roleArn,
+		RoleSessionName: sessionName,
+		Credentials:     creds,
+		Client:          http.DefaultClient,
+	}
+}
+
+type assumeRoleResponse struct {
+	XMLName xml.Name `xml:"AssumeRoleResponse"`
+	Result  struct {
+		Credentials struct {
+			AccessKeyId     string
+			SecretAccessKey string
+			SessionToken    string
+			Expiration      time.Time
+		}
+	} `xml:"AssumeRoleResult"`
+}
+
+func (p *AssumeRoleProvider) Retrieve() (accessKey, secretKey, sessionToken string, err error) {
+	endpoint, err := DefaultResolver().Resolve("sts", "us-east-1")
+	if err != nil {
+		return "", "", "", err
+	}
+
+	form := url.Values{
+		"Action":          {"AssumeRole"},
+		"Version":         {"2011-06-15"},
+		"RoleArn":         {p.RoleArn},
+		"RoleSessionName": {p.RoleSessionName},
+	}
+
+	req, err := http.NewRequest("POST", endpoint.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", "", "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	signer := NewSigner(p.Credentials, endpoint)
+	if err := signer.Sign(req); err != nil {
+		return "", "", "", err
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return "", "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", "", fmt.Errorf("aws: sts AssumeRole returned %s", resp.Status)
+	}
+
+	var ar assumeRoleResponse
+	if err := xml.NewDecoder(resp.Body).Decode(&ar); err != nil {
+		return "", "", "", err
+	}
+	p.mu.Lock()
+	p.expiration = ar.Result.Credentials.Expiration
+	p.mu.Unlock()
+	return ar.Result.Credentials.AccessKeyId, ar.Result.Credentials.SecretAccessKey, ar.Result.Credentials.SessionToken, nil
+}
+
+func (p *AssumeRoleProvider) IsExpired() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.expiration.IsZero() || time.Now().After(p.expiration)
+}
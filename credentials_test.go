@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// countingProvider is a Credentials test double that counts Retrieve calls
+// and can be made to fail or expire on demand.
+type countingProvider struct {
+	calls   int
+	err     error
+	access  string
+	expired bool
+}
+
+func (p *countingProvider) Retrieve() (accessKey, secretKey, sessionToken string, err error) {
+	p.calls++
+	if p.err != nil {
+		return "", "", "", p.err
+	}
+	return p.access, "secret", "", nil
+}
+
+func (p *countingProvider) IsExpired() bool {
+	return p.expired
+}
+
+func TestChainProviderCachesUntilExpired(t *testing.T) {
+	p := &countingProvider{access: "AKID"}
+	c := NewChainProvider(p)
+
+	for i := 0; i < 3; i++ {
+		accessKey, _, _, err := c.Retrieve()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accessKey != "AKID" {
+			t.Errorf("accessKey = %q, want AKID", accessKey)
+		}
+	}
+	if p.calls != 1 {
+		t.Errorf("provider retrieved %d times while valid, want 1 (cached)", p.calls)
+	}
+
+	p.expired = true
+	if _, _, _, err := c.Retrieve(); err != nil {
+		t.Fatal(err)
+	}
+	if p.calls != 2 {
+		t.Errorf("provider retrieved %d times after expiring, want 2 (refreshed)", p.calls)
+	}
+}
+
+func TestChainProviderFallsThroughOnError(t *testing.T) {
+	failing := &countingProvider{err: errors.New("boom")}
+	working := &countingProvider{access: "AKID2"}
+	c := NewChainProvider(failing, working)
+
+	accessKey, _, _, err := c.Retrieve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accessKey != "AKID2" {
+		t.Errorf("accessKey = %q, want AKID2", accessKey)
+	}
+	if failing.calls != 1 {
+		t.Errorf("failing provider retrieved %d times, want 1", failing.calls)
+	}
+	if working.calls != 1 {
+		t.Errorf("working provider retrieved %d times, want 1", working.calls)
+	}
+
+	// The cached (working) provider must answer subsequent calls without
+	// consulting failing again.
+	if _, _, _, err := c.Retrieve(); err != nil {
+		t.Fatal(err)
+	}
+	if failing.calls != 1 {
+		t.Errorf("failing provider retrieved again after a provider was cached: %d calls", failing.calls)
+	}
+}
+
+func TestChainProviderAllFail(t *testing.T) {
+	c := NewChainProvider(&countingProvider{err: errors.New("boom")})
+	if _, _, _, err := c.Retrieve(); err == nil {
+		t.Fatal("expected an error when every provider in the chain fails")
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import "fmt"
+
+// ResolvedEndpoint is what a Resolver produces for a (service, region)
+// pair: the URL to call, and the region/service name that belong in the
+// Sigv4 credential scope. SigningRegion and SigningName usually match
+// region and service, but some services (S3's legacy global endpoint, IAM,
+// STS's classic global endpoint) sign as a fixed region regardless of the
+// hostname requested.
+type ResolvedEndpoint struct {
+	URL           string
+	SigningRegion string
+	SigningName   string
+}
+
+// partition is a group of regions sharing a DNS suffix, mirroring the AWS
+// SDK's notion of a partition (aws, aws-cn, aws-us-gov, ...).
+type partition struct {
+	id        string
+	dnsSuffix string
+	regions   []string
+	services  []string // services offered anywhere in this partition
+}
+
+// standardServices is the full catalog of major services resolvable in the
+// aws partition: s3, glacier, ec2, sts, dynamodb, sqs, sns, kms and iam.
+var standardServices = []string{"s3", "glacier", "ec2", "sts", "dynamodb", "sqs", "sns", "kms", "iam"}
+
+var partitions = []partition{
+	{
+		id:        "aws",
+		dnsSuffix: "amazonaws.com",
+		regions: []string{
+			"us-east-1", "us-east-2", "us-west-1", "us-west-2",
+			"eu-west-1", "eu-central-1",
+			"ap-southeast-1", "ap-southeast-2", "ap-northeast-1",
+			"sa-east-1",
+		},
+		services: standardServices,
+	},
+	{
+		id:        "aws-cn",
+		dnsSuffix: "amazonaws.com.cn",
+		regions:   []string{"cn-north-1", "cn-northwest-1"},
+		// Glacier has never launched in the China partition.
+		services: []string{"s3", "ec2", "sts", "dynamodb", "sqs", "sns", "kms", "iam"},
+	},
+	{
+		id:        "aws-us-gov",
+		dnsSuffix: "amazonaws.com",
+		regions:   []string{"us-gov-west-1", "us-gov-east-1"},
+		services:  standardServices,
+	},
+}
+
+// exceptionKey identifies a (service, partition, region) override. An empty
+// region matches every region in the partition.
+type exceptionKey struct {
+	service   string
+	partition string
+	region    string
+}
+
+// exception overrides some part of the default "<service>.<region>.<dnsSuffix>"
+// endpoint / "<region>"/"<service>" signing scope.
+type exception struct {
+	host          string // overrides the hostname when non-empty
+	signingRegion string // overrides SigningRegion when non-empty
+}
+
+// exceptions holds the services whose endpoint or signing region deviates
+// from the "<service>.<region>.<dnsSuffix>" / sign-as-requested default:
+// IAM is a global service that always signs as us-east-1 (us-gov-west-1 in
+// the gov-cloud partition), classic STS defaults to a single global
+// endpoint, and S3's original us-east-1 endpoint has no region in its
+// hostname.
+var exceptions = map[exceptionKey]exception{
+	{"iam", "aws", ""}:         {host: "iam.amazonaws.com", signingRegion: "us-east-1"},
+	{"iam", "aws-us-gov", ""}:  {host: "iam.us-gov.amazonaws.com", signingRegion: "us-gov-west-1"},
+	{"sts", "aws", ""}:         {host: "sts.amazonaws.com", signingRegion: "us-east-1"},
+	{"s3", "aws", "us-east-1"}: {host: "s3.amazonaws.com"},
+}
+
+// Resolver resolves a (service, region) pair to a ResolvedEndpoint, first
+// checking any custom endpoints registered with WithCustomEndpoint, then
+// falling back to the embedded static table.
+type Resolver struct {
+	custom map[exceptionKey]ResolvedEndpoint
+}
+
+// DefaultResolver returns a Resolver backed by the embedded static table of
+// standard AWS endpoints, with no custom overrides.
+func DefaultResolver() *Resolver {
+	return &Resolver{}
+}
+
+// WithCustomEndpoint registers url as the endpoint for service in region,
+// overriding the static table. It returns the Resolver so calls can be
+// chained. This is meant for private endpoints and local test doubles like
+// localstack, which don't appear in the standard table.
+func (r *Resolver) WithCustomEndpoint(service, region, url string) *Resolver {
+	if r.custom == nil {
+		r.custom = make(map[exceptionKey]ResolvedEndpoint)
+	}
+	r.custom[exceptionKey{service: service, region: region}] = ResolvedEndpoint{
+		URL:           url,
+		SigningRegion: region,
+		SigningName:   service,
+	}
+	return r
+}
+
+// Resolve returns the endpoint for service in region.
+func (r *Resolver) Resolve(service, region string) (ResolvedEndpoint, error) {
+	if ep, ok := r.custom[exceptionKey{service: service, region: region}]; ok {
+		return ep, nil
+	}
+
+	part, ok := findPartition(region)
+	if !ok {
+		return ResolvedEndpoint{}, fmt.Errorf("aws: unknown region %q", region)
+	}
+	if !partitionHasService(part, service) {
+		return ResolvedEndpoint{}, fmt.Errorf("aws: service %q is not in the endpoint table for partition %q", service, part.id)
+	}
+
+	host := service + "." + region + "." + part.dnsSuffix
+	signingRegion := region
+
+	exc, ok := exceptions[exceptionKey{service: service, partition: part.id, region: region}]
+	if !ok {
+		exc, ok = exceptions[exceptionKey{service: service, partition: part.id}]
+	}
+	if ok {
+		if exc.host != "" {
+			host = exc.host
+		}
+		if exc.signingRegion != "" {
+			signingRegion = exc.signingRegion
+		}
+	}
+
+	return ResolvedEndpoint{
+		URL:           "https://" + host,
+		SigningRegion: signingRegion,
+		SigningName:   service,
+	}, nil
+}
+
+func findPartition(region string) (partition, bool) {
+	for _, part := range partitions {
+		for _, r := range part.regions {
+			if r == region {
+				return part, true
+			}
+		}
+	}
+	return partition{}, false
+}
+
+func partitionHasService(part partition, service string) bool {
+	for _, s := range part.services {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
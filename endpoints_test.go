@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+func TestResolverExceptionTable(t *testing.T) {
+	r := DefaultResolver()
+
+	tests := []struct {
+		name, service, region string
+		wantURL               string
+		wantSigningRegion     string
+	}{
+		{"default", "glacier", "us-west-2", "https://glacier.us-west-2.amazonaws.com", "us-west-2"},
+		{"sts global endpoint", "sts", "us-east-1", "https://sts.amazonaws.com", "us-east-1"},
+		{"iam global endpoint", "iam", "us-east-1", "https://iam.amazonaws.com", "us-east-1"},
+		{"iam in gov-cloud", "iam", "us-gov-west-1", "https://iam.us-gov.amazonaws.com", "us-gov-west-1"},
+		{"s3 legacy us-east-1", "s3", "us-east-1", "https://s3.amazonaws.com", "us-east-1"},
+		{"s3 elsewhere uses the regional default", "s3", "us-west-2", "https://s3.us-west-2.amazonaws.com", "us-west-2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep, err := r.Resolve(tt.service, tt.region)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ep.URL != tt.wantURL {
+				t.Errorf("URL = %q, want %q", ep.URL, tt.wantURL)
+			}
+			if ep.SigningRegion != tt.wantSigningRegion {
+				t.Errorf("SigningRegion = %q, want %q", ep.SigningRegion, tt.wantSigningRegion)
+			}
+			if ep.SigningName != tt.service {
+				t.Errorf("SigningName = %q, want %q", ep.SigningName, tt.service)
+			}
+		})
+	}
+}
+
+func TestResolverRejectsUnknownRegionOrService(t *testing.T) {
+	r := DefaultResolver()
+
+	if _, err := r.Resolve("glacier", "mars-east-1"); err == nil {
+		t.Error("expected an error for an unknown region")
+	}
+	// Glacier has never launched in the China partition.
+	if _, err := r.Resolve("glacier", "cn-north-1"); err == nil {
+		t.Error("expected an error for a service missing from a partition")
+	}
+}
+
+func TestResolverWithCustomEndpoint(t *testing.T) {
+	r := DefaultResolver().WithCustomEndpoint("s3", "us-east-1", "http://localhost:4566")
+
+	ep, err := r.Resolve("s3", "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ep.URL != "http://localhost:4566" {
+		t.Errorf("URL = %q, want the custom override", ep.URL)
+	}
+
+	// The override must be scoped to exactly the (service, region) it was
+	// registered for, not leak into other lookups on the same Resolver.
+	other, err := r.Resolve("glacier", "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.URL != "https://glacier.us-east-1.amazonaws.com" {
+		t.Errorf("unrelated service URL = %q, affected by custom endpoint", other.URL)
+	}
+}
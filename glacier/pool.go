@@ -0,0 +1,87 @@
+package glacier
+
+import (
+	"crypto/sha256"
+	"io"
+	"sync"
+)
+
+// scratchPool holds reusable 1 MiB buffers. TreeHashReader borrows one as
+// its read buffer and returns it before returning, so repeated calls avoid
+// a fresh allocation when the pool already has a spare. TreeHash's own
+// remaining buffer isn't drawn from here: a TreeHash can outlive any single
+// call and has no point at which it's safe to return the buffer, so
+// amortizing that cost is left to TreeHashPool, which keeps the whole
+// *TreeHash (remaining buffer included) alive across Reserve/Release.
+var scratchPool = sync.Pool{
+	New: func() interface{} { return make([]byte, chunkSize) },
+}
+
+// TreeHashPool lets a high-throughput uploader reuse TreeHash instances
+// across archives instead of letting each one's per-chunk sha256 states,
+// remaining buffer and nodes slice be garbage collected between uploads.
+// It is modeled on the bounded-channel object pool BMT uses for its
+// TreePool.
+type TreeHashPool struct {
+	pool chan *TreeHash
+}
+
+// NewTreeHashPool returns a TreeHashPool holding up to size idle TreeHash
+// instances.
+func NewTreeHashPool(size int) *TreeHashPool {
+	return &TreeHashPool{pool: make(chan *TreeHash, size)}
+}
+
+// Reserve returns an idle TreeHash from the pool, or a freshly constructed
+// one if the pool is currently empty.
+func (p *TreeHashPool) Reserve() *TreeHash {
+	select {
+	case th := <-p.pool:
+		return th
+	default:
+		return NewTreeHash()
+	}
+}
+
+// Release resets th and returns it to the pool for the next Reserve. If the
+// pool is already full, th is dropped and left for garbage collection.
+func (p *TreeHashPool) Release(th *TreeHash) {
+	th.Reset()
+	select {
+	case p.pool <- th:
+	default:
+	}
+}
+
+// TreeHashReader computes the tree hash and linear sha256 hash of
+// everything read from r, returning the number of bytes read. It reads
+// exactly 1 MiB at a time into a buffer borrowed from scratchPool and feeds
+// each chunk straight to WriteChunk, so no chunk is copied on its way in.
+// The TreeHash it builds is a fresh NewTreeHash, which still allocates its
+// own sha256 state and 1 MiB remaining buffer, and its nodes and levels.
+func TreeHashReader(r io.Reader) (tree, linear [sha256.Size]byte, n int64, err error) {
+	th := NewTreeHash()
+	buf := scratchPool.Get().([]byte)
+	defer scratchPool.Put(buf)
+
+	for {
+		read, rerr := io.ReadFull(r, buf)
+		if read > 0 {
+			th.WriteChunk(buf[:read])
+			n += int64(read)
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			return tree, linear, n, rerr
+		}
+	}
+
+	if err := th.Close(); err != nil {
+		return tree, linear, n, err
+	}
+	copy(tree[:], th.TreeHash())
+	copy(linear[:], th.Hash())
+	return tree, linear, n, nil
+}
@@ -4,8 +4,12 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"hash"
+	"sync"
 )
 
+// chunkSize is the size of a Glacier tree-hash leaf.
+const chunkSize = 1 << 20
+
 // MultiTreeHasher is used to calculate tree hashes for multi-part uploads
 // Call Add sequentially on hashes you have calculated them for
 // parts individually, and CreateHash to get the resulting root-level
@@ -52,6 +56,22 @@ func treeHash(nodes [][sha256.Size]byte) [sha256.Size]byte {
 	return nodes[0]
 }
 
+// chunkJob is a single 1 MiB chunk dispatched to the worker pool, tagged
+// with its position in the stream so results can be reassembled in order.
+type chunkJob struct {
+	index int
+	data  []byte
+}
+
+// chunkResult is a worker's answer to a chunkJob. data is carried back
+// alongside the hash so the collector can feed the linear hash in order
+// without the workers touching runningHash themselves.
+type chunkResult struct {
+	index int
+	hash  [sha256.Size]byte
+	data  []byte
+}
+
 // TreeHash is used to calculate the tree hash and regular sha256 hash of the
 // data written to it. These values are needed when uploading an archive or
 // verifying an aligned download. First each 1 MiB chunk of data is hashed.
@@ -59,31 +79,88 @@ func treeHash(nodes [][sha256.Size]byte) [sha256.Size]byte {
 // there is a single node left it is promoted to the next level). The second
 // step is repeated until there is only a single node, this is the tree hash.
 // See docs.aws.amazon.com/amazonglacier/latest/dev/checksum-calculations.html
+//
+// A TreeHash created with NewParallelTreeHash dispatches full chunks to a
+// fixed pool of worker goroutines instead of hashing them inline; see
+// NewParallelTreeHash for details. WriteChunk skips the copy into
+// th.remaining that Write does; a plain TreeHash then hashes the chunk
+// directly out of the caller's buffer, while a parallel one still copies it
+// for its workers. TreeHashPool and TreeHashReader build on it for
+// high-throughput callers.
 type TreeHash struct {
 	remaining   []byte
 	nodes       [][sha256.Size]byte
-	runningHash hash.Hash         // linear
-	treeHash    [sha256.Size]byte // computed
-	linearHash  [sha256.Size]byte // computed
+	levels      [][][sha256.Size]byte // every level of the tree, leaves to root; set by Close
+	runningHash hash.Hash             // linear
+	treeHash    [sha256.Size]byte     // computed
+	linearHash  [sha256.Size]byte     // computed
+
+	// Parallel leaf hashing. workers is 0 for a plain TreeHash, in which
+	// case jobs/results/etc. are left nil and Write hashes inline.
+	workers     int
+	hasherPool  sync.Pool
+	jobs        chan chunkJob
+	results     chan chunkResult
+	workerWG    sync.WaitGroup
+	collectDone chan struct{}
+	dispatched  int
 }
 
 // NewTreeHash returns an new, initialized tree hasher.
 func NewTreeHash() *TreeHash {
 	result := &TreeHash{
 		runningHash: sha256.New(),
-		remaining:   make([]byte, 0, 1<<20),
+		remaining:   make([]byte, 0, chunkSize),
+	}
+	result.Reset()
+	return result
+}
+
+// NewParallelTreeHash returns a TreeHash that hashes full 1 MiB chunks on a
+// fixed pool of workers goroutines instead of on the caller's goroutine.
+// Chunks are tagged with a monotonically-increasing index when dispatched so
+// a collector goroutine can fold the results back into the tree-hash nodes
+// and the linear sha256 hash in submission order, since both are
+// order-sensitive. Close drains the pool, hashes the final short remainder
+// on the caller goroutine, then runs the usual pairwise reduction.
+func NewParallelTreeHash(workers int) *TreeHash {
+	if workers < 1 {
+		workers = 1
+	}
+	result := &TreeHash{
+		runningHash: sha256.New(),
+		remaining:   make([]byte, 0, chunkSize),
+		workers:     workers,
 	}
+	result.hasherPool.New = func() interface{} { return sha256.New() }
 	result.Reset()
 	return result
 }
 
-// Reset the tree hash's state allowing it to be reused.
+// Reset the tree hash's state allowing it to be reused. For a parallel
+// TreeHash this drains and restarts the worker pool.
 func (th *TreeHash) Reset() {
+	if th.jobs != nil {
+		th.drainPool()
+	}
 	th.runningHash.Reset()
 	th.remaining = th.remaining[:0]
 	th.nodes = th.nodes[:0]
+	th.levels = nil
 	th.treeHash = [sha256.Size]byte{}
 	th.linearHash = [sha256.Size]byte{}
+	th.dispatched = 0
+
+	if th.workers > 0 {
+		th.jobs = make(chan chunkJob, th.workers*2)
+		th.results = make(chan chunkResult, th.workers*2)
+		th.collectDone = make(chan struct{})
+		th.workerWG.Add(th.workers)
+		for i := 0; i < th.workers; i++ {
+			go th.worker()
+		}
+		go th.collect()
+	}
 }
 
 // Write writes all of p, storing every 1 MiB of data's hash.
@@ -91,26 +168,24 @@ func (th *TreeHash) Write(p []byte) (int, error) {
 	n := len(p)
 
 	// Not enough data to fill a 1 MB chunk.
-	if len(th.remaining)+len(p) < 1<<20 {
+	if len(th.remaining)+len(p) < chunkSize {
 		th.remaining = append(th.remaining, p...)
 		return n, nil
 	}
 
 	// Move enough to fill th.remaining to 1 MB.
-	fill := 1<<20 - len(th.remaining)
+	fill := chunkSize - len(th.remaining)
 	th.remaining = append(th.remaining, p[:fill]...)
 	p = p[fill:]
-
-	// Append the 1 MB in th.remaining.
-	th.nodes = append(th.nodes, sha256.Sum256(th.remaining))
-	th.runningHash.Write(th.remaining)
+	th.submitChunk(th.remaining)
+	// submitChunk has already hashed or copied th.remaining, so its
+	// backing array is free to reuse.
 	th.remaining = th.remaining[:0]
 
 	// Append all 1M chunks remaining in p.
-	for len(p) >= 1<<20 {
-		th.nodes = append(th.nodes, sha256.Sum256(p[:1<<20]))
-		th.runningHash.Write(p[:1<<20])
-		p = p[1<<20:]
+	for len(p) >= chunkSize {
+		th.submitChunk(p[:chunkSize])
+		p = p[chunkSize:]
 	}
 
 	// Copy what remains in p to th.remaining.
@@ -119,21 +194,181 @@ func (th *TreeHash) Write(p []byte) (int, error) {
 	return n, nil
 }
 
+// submitChunk hashes one chunk (chunkSize bytes, or the short final chunk
+// passed to WriteChunk), either inline or, for a
+// parallel TreeHash, by handing a copy of it to the worker pool tagged with
+// the next submission index.
+func (th *TreeHash) submitChunk(p []byte) {
+	if th.jobs == nil {
+		th.nodes = append(th.nodes, sha256.Sum256(p))
+		th.runningHash.Write(p)
+		return
+	}
+	data := make([]byte, len(p))
+	copy(data, p)
+	th.jobs <- chunkJob{index: th.dispatched, data: data}
+	th.dispatched++
+}
+
+// WriteChunk hashes p as a single chunk, without copying it into
+// th.remaining first. p must be chunkSize bytes, except for the final
+// chunk written before Close, which may be shorter. WriteChunk and Write
+// must not both be used on the same TreeHash between Reset calls.
+func (th *TreeHash) WriteChunk(p []byte) {
+	th.submitChunk(p)
+}
+
+// worker hashes dispatched chunks using a pooled sha256 state, avoiding a
+// reallocation per chunk.
+func (th *TreeHash) worker() {
+	defer th.workerWG.Done()
+	for job := range th.jobs {
+		h := th.hasherPool.Get().(hash.Hash)
+		h.Reset()
+		h.Write(job.data)
+		var sum [sha256.Size]byte
+		h.Sum(sum[:0])
+		th.hasherPool.Put(h)
+		th.results <- chunkResult{index: job.index, hash: sum, data: job.data}
+	}
+}
+
+// collect folds worker results into th.nodes and th.runningHash in
+// submission order, buffering any that arrive out of order until their
+// predecessor has been folded in.
+func (th *TreeHash) collect() {
+	pending := make(map[int]chunkResult)
+	next := 0
+	for r := range th.results {
+		pending[r.index] = r
+		for {
+			res, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			th.nodes = append(th.nodes, res.hash)
+			th.runningHash.Write(res.data)
+			next++
+		}
+	}
+	close(th.collectDone)
+}
+
+// drainPool closes the job queue, waits for every dispatched chunk to be
+// hashed and folded in by the collector, then tears the pool down so Reset
+// or garbage collection can reclaim it.
+func (th *TreeHash) drainPool() {
+	close(th.jobs)
+	th.workerWG.Wait()
+	close(th.results)
+	<-th.collectDone
+	th.jobs = nil
+	th.results = nil
+	th.collectDone = nil
+}
+
 // Close closes the the remaing chunks of data and then calculates the tree hash.
 func (th *TreeHash) Close() error {
+	if th.jobs != nil {
+		th.drainPool()
+	}
 	// create last node; it is impossible that it has a size > 1 MB
 	if len(th.remaining) > 0 {
 		th.nodes = append(th.nodes, sha256.Sum256(th.remaining))
 		th.runningHash.Write(th.remaining)
 	}
-	// Calculate the tree and linear hashes
+	// Calculate the tree and linear hashes, keeping every level so Proof
+	// can later produce inclusion proofs against the root.
 	if len(th.nodes) > 0 {
-		th.treeHash = treeHash(th.nodes)
+		th.levels = buildLevels(th.nodes)
+		th.treeHash = th.levels[len(th.levels)-1][0]
 	}
 	th.runningHash.Sum(th.linearHash[:0])
 	return nil
 }
 
+// buildLevels performs the same pairwise reduction as treeHash, but unlike
+// treeHash it keeps every intermediate level (leaves first, root last)
+// instead of collapsing in place, so Proof can walk back down from the root.
+func buildLevels(leaves [][sha256.Size]byte) [][][sha256.Size]byte {
+	level := append([][sha256.Size]byte(nil), leaves...)
+	levels := [][][sha256.Size]byte{level}
+	var combine [sha256.Size * 2]byte
+	for len(level) > 1 {
+		next := make([][sha256.Size]byte, 0, (len(level)+1)/2)
+		for i := 0; i+1 < len(level); i += 2 {
+			copy(combine[:sha256.Size], level[i][:])
+			copy(combine[sha256.Size:], level[i+1][:])
+			next = append(next, sha256.Sum256(combine[:]))
+		}
+		if len(level)%2 != 0 {
+			// odd node at this level: promoted to the next level unchanged.
+			next = append(next, level[len(level)-1])
+		}
+		levels = append(levels, next)
+		level = next
+	}
+	return levels
+}
+
+// Proof returns the sibling hashes needed to verify that the leaf at
+// partIndex was included in the tree hash, ordered from the leaf's level up
+// to the root, along with the number of nodes present at each of those
+// levels before promotion. Close must have been called first. The level
+// sizes let VerifyTreeHashProof tell an odd, promoted node (which has no
+// sibling) apart from a level with a real sibling to consume from proof.
+func (th *TreeHash) Proof(partIndex int) (proof [][sha256.Size]byte, levelSizes []int) {
+	if partIndex < 0 || len(th.levels) == 0 || partIndex >= len(th.levels[0]) {
+		return nil, nil
+	}
+	idx := partIndex
+	for level := 0; level < len(th.levels)-1; level++ {
+		nodes := th.levels[level]
+		levelSizes = append(levelSizes, len(nodes))
+		if sibling := idx ^ 1; sibling < len(nodes) {
+			proof = append(proof, nodes[sibling])
+		}
+		idx /= 2
+	}
+	return proof, levelSizes
+}
+
+// VerifyTreeHashProof walks proof from leafHash up to root, deciding at each
+// level whether leafHash's current running hash is the left or right operand
+// from the bit pattern of partIndex. levelSizes (as returned by Proof) tells
+// it which levels had no sibling to consume, because an odd node there was
+// promoted unchanged rather than paired and rehashed.
+func VerifyTreeHashProof(leafHash, root [sha256.Size]byte, partIndex int, proof [][sha256.Size]byte, levelSizes []int) bool {
+	cur := leafHash
+	idx := partIndex
+	pi := 0
+	var combine [sha256.Size * 2]byte
+	for _, size := range levelSizes {
+		sibling := idx ^ 1
+		if sibling >= size {
+			// odd node promoted unchanged; nothing to consume from proof.
+			idx /= 2
+			continue
+		}
+		if pi >= len(proof) {
+			return false
+		}
+		sib := proof[pi]
+		pi++
+		if idx%2 == 0 {
+			copy(combine[:sha256.Size], cur[:])
+			copy(combine[sha256.Size:], sib[:])
+		} else {
+			copy(combine[:sha256.Size], sib[:])
+			copy(combine[sha256.Size:], cur[:])
+		}
+		cur = sha256.Sum256(combine[:])
+		idx /= 2
+	}
+	return pi == len(proof) && cur == root
+}
+
 // TreeHash returns the root-level tree hash of everything written.
 func (th *TreeHash) TreeHash() []byte {
 	return th.treeHash[:]
@@ -0,0 +1,98 @@
+package glacier
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+)
+
+// TestParallelMatchesSerial checks that NewParallelTreeHash produces the same
+// tree hash and linear hash as the serial NewTreeHash for the same data,
+// across sizes that land on, above and below a chunk boundary.
+func TestParallelMatchesSerial(t *testing.T) {
+	sizes := []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 777}
+	for _, size := range sizes {
+		data := make([]byte, size)
+		rand.Read(data)
+
+		serial := NewTreeHash()
+		serial.Write(data)
+		if err := serial.Close(); err != nil {
+			t.Fatalf("size %d: serial Close: %v", size, err)
+		}
+
+		parallel := NewParallelTreeHash(4)
+		parallel.Write(data)
+		if err := parallel.Close(); err != nil {
+			t.Fatalf("size %d: parallel Close: %v", size, err)
+		}
+
+		if !bytes.Equal(serial.TreeHash(), parallel.TreeHash()) {
+			t.Errorf("size %d: tree hash mismatch: serial %x, parallel %x", size, serial.TreeHash(), parallel.TreeHash())
+		}
+		if !bytes.Equal(serial.Hash(), parallel.Hash()) {
+			t.Errorf("size %d: linear hash mismatch: serial %x, parallel %x", size, serial.Hash(), parallel.Hash())
+		}
+	}
+}
+
+// TestParallelWriteChunkRaggedFinal exercises WriteChunk with full chunks
+// plus a short final chunk, the path a high-throughput uploader takes, and
+// checks the result still matches the serial Write path.
+func TestParallelWriteChunkRaggedFinal(t *testing.T) {
+	data := make([]byte, 3*chunkSize+777)
+	rand.Read(data)
+
+	serial := NewTreeHash()
+	serial.Write(data)
+	if err := serial.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	parallel := NewParallelTreeHash(3)
+	for i := 0; i+chunkSize <= len(data); i += chunkSize {
+		parallel.WriteChunk(data[i : i+chunkSize])
+	}
+	parallel.WriteChunk(data[len(data)/chunkSize*chunkSize:])
+	if err := parallel.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(serial.TreeHash(), parallel.TreeHash()) {
+		t.Errorf("tree hash mismatch: serial %x, parallel %x", serial.TreeHash(), parallel.TreeHash())
+	}
+	if !bytes.Equal(serial.Hash(), parallel.Hash()) {
+		t.Errorf("linear hash mismatch: serial %x, parallel %x", serial.Hash(), parallel.Hash())
+	}
+}
+
+// TestProofRoundTrip checks that Proof/VerifyTreeHashProof round-trip for
+// every leaf across tree sizes with and without odd-node promotions.
+func TestProofRoundTrip(t *testing.T) {
+	for _, leaves := range []int{1, 2, 3, 4, 5, 7, 8, 13} {
+		data := make([]byte, leaves*chunkSize)
+		rand.Read(data)
+
+		th := NewTreeHash()
+		th.Write(data)
+		if err := th.Close(); err != nil {
+			t.Fatal(err)
+		}
+		var root [sha256.Size]byte
+		copy(root[:], th.TreeHash())
+
+		for i := 0; i < leaves; i++ {
+			leaf := sha256.Sum256(data[i*chunkSize : (i+1)*chunkSize])
+			proof, sizes := th.Proof(i)
+			if !VerifyTreeHashProof(leaf, root, i, proof, sizes) {
+				t.Errorf("leaves=%d part=%d: valid proof failed to verify", leaves, i)
+			}
+			tampered := leaf
+			tampered[0] ^= 0xFF
+			if VerifyTreeHashProof(tampered, root, i, proof, sizes) {
+				t.Errorf("leaves=%d part=%d: tampered leaf verified", leaves, i)
+			}
+		}
+	}
+}